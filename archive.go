@@ -0,0 +1,484 @@
+package ramfs
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/goplan9/plan9"
+)
+
+// ExportTar writes the entire tree rooted at fs.root to w as a tar
+// archive, preserving mode, uid/gid and mtime. It is the counterpart of
+// ImportTar and is meant to snapshot a tree populated at startup back
+// out on shutdown.
+func (fs *FS) ExportTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := fs.walkExport("", func(rel string, dir plan9.Dir, r io.Reader) error {
+		if rel == "" {
+			return nil
+		}
+		hdr := &tar.Header{
+			Name:    rel,
+			Mode:    int64(dir.Mode & 0777),
+			Uname:   dir.Uid,
+			Gname:   dir.Gid,
+			ModTime: time.Unix(int64(dir.Mtime), 0),
+		}
+		if dir.Mode&plan9.DMDIR != 0 {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(dir.Length)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if r == nil {
+			return nil
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ImportTar populates the tree from a tar archive previously written by
+// ExportTar (or any well-formed tar stream), creating intermediate
+// directories as needed. Entries that would escape the root via ".."
+// are rejected.
+func (fs *FS) ImportTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if strings.Contains(hdr.Name, "..") {
+			return perror("tar entry escapes root: " + hdr.Name)
+		}
+		name := path.Clean("/" + strings.TrimSuffix(hdr.Name, "/"))
+		if name == "/" {
+			continue
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if _, err := fs.mkdirAll(name); err != nil {
+				return err
+			}
+			fid, err := fs.Open(name, OREAD)
+			if err != nil {
+				return err
+			}
+			err = fs.wstatMeta(fid, hdr.Uname, hdr.Gname, uint32(hdr.ModTime.Unix()))
+			fid.Clunk()
+			if err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := fs.importFile(name, hdr.Mode, hdr.Uname, hdr.Gname, hdr.ModTime, tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := fs.importSymlink(name, hdr.Linkname, hdr.Uname, hdr.Gname, hdr.ModTime); err != nil {
+				return err
+			}
+		default:
+			return perror("unsupported tar entry type: " + hdr.Name)
+		}
+	}
+}
+
+// walkExport depth-first walks the tree starting at /rel, calling visit
+// once per node with its path relative to the root ("" for the root
+// itself) and, for plain files, a reader over their content.
+func (fs *FS) walkExport(rel string, visit func(rel string, dir plan9.Dir, r io.Reader) error) error {
+	full := "/" + rel
+	fid, err := fs.Open(full, OREAD)
+	if err != nil {
+		return err
+	}
+	dir, err := fid.Stat()
+	if err != nil {
+		fid.Clunk()
+		return err
+	}
+
+	if dir.Mode&plan9.DMDIR == 0 {
+		defer fid.Clunk()
+		return visit(rel, dir, &fidReader{fs: fs, fid: fid})
+	}
+
+	n, err := fs.walk(full)
+	fid.Clunk()
+	if err != nil {
+		return err
+	}
+	if err := visit(rel, dir, nil); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		childRel := name
+		if rel != "" {
+			childRel = rel + "/" + name
+		}
+		if err := fs.walkExport(childRel, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mkdirAll walks name one element at a time, creating any directory
+// that does not yet exist.
+func (fs *FS) mkdirAll(name string) (*node, error) {
+	n, err := fs.walk(name)
+	if err == nil {
+		return n, nil
+	}
+
+	dname, base := path.Dir(name), path.Base(name)
+	parent, err := fs.mkdirAll(dname)
+	if err != nil {
+		return nil, err
+	}
+	user, err := fs.group.Get(fs.hostowner)
+	if err != nil {
+		panic(err) // can't happen
+	}
+	child, err := parent.Create(user.Name, base, 0, plan9.Perm(0755)|plan9.DMDIR)
+	parent.Close()
+	return child, err
+}
+
+func (fs *FS) importFile(name string, mode int64, uid, gid string, mtime time.Time, r io.Reader) error {
+	if _, err := fs.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+
+	fid, err := fs.Create(name, OWRITE|OTRUNC, Perm(mode)&0777)
+	if err != nil {
+		fid, err = fs.Open(name, OWRITE|OTRUNC)
+		if err != nil {
+			return err
+		}
+	}
+	defer fid.Clunk()
+
+	if _, err := io.Copy(&fidWriter{fs: fs, fid: fid}, r); err != nil {
+		return err
+	}
+	return fs.wstatMeta(fid, uid, gid, uint32(mtime.Unix()))
+}
+
+// importSymlink creates name as a DMSYMLINK node whose content is the
+// link target, the same representation dotL's SymlinkL/ReadlinkL use.
+func (fs *FS) importSymlink(name, target, uid, gid string, mtime time.Time) error {
+	if _, err := fs.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	fid, err := fs.Create(name, OWRITE, Perm(0777)|Perm(plan9.DMSYMLINK))
+	if err != nil {
+		return err
+	}
+	defer fid.Clunk()
+	if _, err := fid.Write([]byte(target), 0); err != nil {
+		return err
+	}
+	return fs.wstatMeta(fid, uid, gid, uint32(mtime.Unix()))
+}
+
+// wstatMeta restores mtime and, for the names actually registered in
+// this tree's /adm/group, ownership. An archived uid/gid that this tree
+// doesn't recognize is left alone rather than failing the whole import.
+func (fs *FS) wstatMeta(fid *Fid, uid, gid string, mtime uint32) error {
+	var dir plan9.Dir
+	dir.Null()
+	dir.Mtime = mtime
+	if uid != "" {
+		if _, err := fs.group.Get(uid); err == nil {
+			dir.Uid = uid
+		}
+	}
+	if gid != "" {
+		if _, err := fs.group.Get(gid); err == nil {
+			dir.Gid = gid
+		}
+	}
+	return fid.Wstat(dir)
+}
+
+type fidReader struct {
+	fs     *FS
+	fid    *Fid
+	offset int64
+}
+
+func (r *fidReader) Read(p []byte) (int, error) {
+	n, err := r.fs.ReadAt(r.fid, p, r.offset)
+	r.offset += int64(n)
+	if n == 0 && err == nil {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+type fidWriter struct {
+	fs     *FS
+	fid    *Fid
+	offset int64
+}
+
+func (w *fidWriter) Write(p []byte) (int, error) {
+	n, err := w.fs.WriteAt(w.fid, p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+// cpio (newc) support. archive/cpio does not exist in the standard
+// library, so ExportCpio/ImportCpio speak the portable ASCII "070701"
+// format directly; it is simple enough that pulling in a dependency
+// for it isn't worth it.
+//
+// The newc header only has room for a numeric uid/gid, but ramfs tracks
+// ownership as names resolved against a *group (see FS.wstatMeta), so
+// ExportCpio assigns each distinct name a small id and writes the id ->
+// name table as a regular entry, cpioOwnersName, ahead of everything
+// else; ImportCpio reads it back first and resolves the numeric
+// uid/gid on every later entry against it.
+const (
+	cpioMagic      = "070701"
+	cpioTrailer    = "TRAILER!!!"
+	cpioOwnersName = ".ramfs.owners"
+)
+
+func cpioPad(n int) int { return (4 - n%4) % 4 }
+
+// ExportCpio is the cpio equivalent of ExportTar.
+func (fs *FS) ExportCpio(w io.Writer) error {
+	ids := map[string]uint32{}
+	var names []string
+	collect := func(name string) {
+		if name == "" {
+			return
+		}
+		if _, ok := ids[name]; ok {
+			return
+		}
+		ids[name] = uint32(len(names) + 1)
+		names = append(names, name)
+	}
+	if err := fs.walkExport("", func(rel string, dir plan9.Dir, r io.Reader) error {
+		collect(dir.Uid)
+		collect(dir.Gid)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var owners strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&owners, "%d\t%s\n", ids[name], name)
+	}
+	if err := writeCpioEntry(w, cpioOwnersName, 0100644, 0, 0, 0, strings.NewReader(owners.String()), uint32(owners.Len())); err != nil {
+		return err
+	}
+
+	err := fs.walkExport("", func(rel string, dir plan9.Dir, r io.Reader) error {
+		if rel == "" {
+			return nil
+		}
+		mode := uint32(dir.Mode & 0777)
+		var size uint32
+		if dir.Mode&plan9.DMDIR != 0 {
+			mode |= 0040000 // S_IFDIR
+		} else {
+			mode |= 0100000 // S_IFREG
+			size = uint32(dir.Length)
+		}
+		return writeCpioEntry(w, rel, mode, ids[dir.Uid], ids[dir.Gid], dir.Mtime, r, size)
+	})
+	if err != nil {
+		return err
+	}
+	return writeCpioHeader(w, cpioTrailer, 0, 0, 0, 0, 0)
+}
+
+// ImportCpio is the cpio equivalent of ImportTar.
+func (fs *FS) ImportCpio(r io.Reader) error {
+	owners := map[uint32]string{}
+
+	name, mode, uid, gid, mtime, size, err := readCpioHeader(r)
+	if err != nil {
+		return err
+	}
+	if name == cpioOwnersName {
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		if pad := cpioPad(int(size)); pad > 0 {
+			if _, err := io.CopyN(ioutil.Discard, r, int64(pad)); err != nil {
+				return err
+			}
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(buf), "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			tab := strings.IndexByte(line, '\t')
+			if tab < 0 {
+				continue
+			}
+			idStr, ownerName := line[:tab], line[tab+1:]
+			id, err := strconv.ParseUint(idStr, 10, 32)
+			if err != nil {
+				continue
+			}
+			owners[uint32(id)] = ownerName
+		}
+		name, mode, uid, gid, mtime, size, err = readCpioHeader(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		if name == cpioTrailer {
+			return nil
+		}
+		if strings.Contains(name, "..") {
+			return perror("cpio entry escapes root: " + name)
+		}
+		full := path.Clean("/" + name)
+
+		if mode&0170000 == 0040000 {
+			if _, err := fs.mkdirAll(full); err != nil {
+				return err
+			}
+			fid, err := fs.Open(full, OREAD)
+			if err != nil {
+				return err
+			}
+			err = fs.wstatMeta(fid, owners[uid], owners[gid], mtime)
+			fid.Clunk()
+			if err != nil {
+				return err
+			}
+		} else {
+			if _, err := fs.mkdirAll(path.Dir(full)); err != nil {
+				return err
+			}
+			fid, err := fs.Create(full, OWRITE|OTRUNC, Perm(mode)&0777)
+			if err != nil {
+				fid, err = fs.Open(full, OWRITE|OTRUNC)
+				if err != nil {
+					return err
+				}
+			}
+			if _, err := io.CopyN(&fidWriter{fs: fs, fid: fid}, r, int64(size)); err != nil {
+				fid.Clunk()
+				return err
+			}
+			if pad := cpioPad(int(size)); pad > 0 {
+				if _, err := io.CopyN(ioutil.Discard, r, int64(pad)); err != nil {
+					fid.Clunk()
+					return err
+				}
+			}
+			err = fs.wstatMeta(fid, owners[uid], owners[gid], mtime)
+			fid.Clunk()
+			if err != nil {
+				return err
+			}
+		}
+
+		name, mode, uid, gid, mtime, size, err = readCpioHeader(r)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeCpioEntry(w io.Writer, name string, mode, uid, gid, mtime uint32, r io.Reader, size uint32) error {
+	if err := writeCpioHeader(w, name, mode, uid, gid, mtime, size); err != nil {
+		return err
+	}
+	if r == nil {
+		return nil
+	}
+	n, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(make([]byte, cpioPad(int(n))))
+	return err
+}
+
+func writeCpioHeader(w io.Writer, name string, mode, uid, gid, mtime, filesize uint32) error {
+	hdr := fmt.Sprintf("%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		cpioMagic, 0 /* ino */, mode, uid, gid,
+		1 /* nlink */, mtime, filesize,
+		0, 0, 0, 0, len(name)+1, 0 /* check */)
+	if _, err := io.WriteString(w, hdr); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, name+"\x00"); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, cpioPad(len(hdr)+len(name)+1)))
+	return err
+}
+
+func readCpioHeader(r io.Reader) (name string, mode, uid, gid, mtime, size uint32, err error) {
+	var buf [110]byte
+	if _, err = io.ReadFull(r, buf[:]); err != nil {
+		return
+	}
+	if string(buf[0:6]) != cpioMagic {
+		err = perror("bad cpio magic")
+		return
+	}
+	field := func(off int) uint32 {
+		v, _ := strconv.ParseUint(string(buf[off:off+8]), 16, 32)
+		return uint32(v)
+	}
+	mode = field(14)
+	uid = field(22)
+	gid = field(30)
+	mtime = field(46)
+	size = field(54)
+	namesize := int(field(94))
+
+	nameBuf := make([]byte, namesize)
+	if _, err = io.ReadFull(r, nameBuf); err != nil {
+		return
+	}
+	name = strings.TrimRight(string(nameBuf), "\x00")
+	if pad := cpioPad(110 + namesize); pad > 0 {
+		if _, err = io.ReadFull(r, make([]byte, pad)); err != nil {
+			return
+		}
+	}
+	return
+}
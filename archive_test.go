@@ -0,0 +1,101 @@
+package ramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func newTestTree(t *testing.T) *FS {
+	fs := New("glenda")
+	if _, err := fs.Create("/dir", OREAD, Perm(0755)|Perm(DMDIR)); err != nil {
+		t.Fatalf("Create /dir: %v", err)
+	}
+	fid, err := fs.Create("/dir/hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create /dir/hello: %v", err)
+	}
+	if _, err := fid.Write([]byte("hello, ramfs"), 0); err != nil {
+		t.Fatalf("Write /dir/hello: %v", err)
+	}
+	fid.Clunk()
+	return fs
+}
+
+func readFile(t *testing.T, fs *FS, name string) string {
+	fid, err := fs.Open(name, OREAD)
+	if err != nil {
+		t.Fatalf("Open %s: %v", name, err)
+	}
+	defer fid.Clunk()
+	dir, err := fid.Stat()
+	if err != nil {
+		t.Fatalf("Stat %s: %v", name, err)
+	}
+	buf := make([]byte, dir.Length)
+	if _, err := fid.Read(buf, 0); err != nil {
+		t.Fatalf("Read %s: %v", name, err)
+	}
+	return string(buf)
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	src := newTestTree(t)
+
+	var buf bytes.Buffer
+	if err := src.ExportTar(&buf); err != nil {
+		t.Fatalf("ExportTar: %v", err)
+	}
+
+	dst := New("glenda")
+	if err := dst.ImportTar(&buf); err != nil {
+		t.Fatalf("ImportTar: %v", err)
+	}
+
+	if got, want := readFile(t, dst, "/dir/hello"), "hello, ramfs"; got != want {
+		t.Errorf("/dir/hello = %q, want %q", got, want)
+	}
+
+	fid, err := dst.Open("/dir/hello", OREAD)
+	if err != nil {
+		t.Fatalf("Open /dir/hello: %v", err)
+	}
+	dir, err := fid.Stat()
+	fid.Clunk()
+	if err != nil {
+		t.Fatalf("Stat /dir/hello: %v", err)
+	}
+	if dir.Uid != "glenda" {
+		t.Errorf("/dir/hello uid = %q, want %q", dir.Uid, "glenda")
+	}
+}
+
+func TestCpioRoundTrip(t *testing.T) {
+	src := newTestTree(t)
+
+	var buf bytes.Buffer
+	if err := src.ExportCpio(&buf); err != nil {
+		t.Fatalf("ExportCpio: %v", err)
+	}
+
+	dst := New("glenda")
+	if err := dst.ImportCpio(&buf); err != nil {
+		t.Fatalf("ImportCpio: %v", err)
+	}
+
+	if got, want := readFile(t, dst, "/dir/hello"), "hello, ramfs"; got != want {
+		t.Errorf("/dir/hello = %q, want %q", got, want)
+	}
+
+	fid, err := dst.Open("/dir/hello", OREAD)
+	if err != nil {
+		t.Fatalf("Open /dir/hello: %v", err)
+	}
+	dir, err := fid.Stat()
+	fid.Clunk()
+	if err != nil {
+		t.Fatalf("Stat /dir/hello: %v", err)
+	}
+	if dir.Uid != "glenda" {
+		t.Errorf("/dir/hello uid = %q, want %q", dir.Uid, "glenda")
+	}
+}
@@ -0,0 +1,197 @@
+package ramfs
+
+import (
+	"io"
+	"net"
+	"path"
+
+	"code.google.com/p/goplan9/plan9"
+)
+
+// File is one open or walked file as seen by the 9P transport. It is
+// the per-fid counterpart of Backend, mirroring the operations a Tfid
+// can request: Twalk, Topen, Tcreate, Tread, Twrite, Tremove, Tstat,
+// Twstat and Tclunk.
+//
+// memFile adapts the in-memory *Fid to this interface so the wire code
+// can be written once against File and still serve the default tree
+// with no behavior change.
+type File interface {
+	Walk(names []string) ([]File, error)
+	Open(mode uint8) error
+	Create(name string, mode uint8, perm Perm) (File, error)
+	Read(p []byte, offset int64) (int, error)
+	Write(p []byte, offset int64) (int, error)
+	Remove() error
+	Stat() (plan9.Dir, error)
+	Wstat(dir plan9.Dir) error
+	Clunk() error
+}
+
+// Backend is the session a 9P server talks to once a client has
+// attached: Attach is the only entry point, everything else happens
+// through the File it returns. memBackend adapts the in-memory FS;
+// ROBackend is a second, independent implementation over a plain
+// map[string][]byte, proving Backend/File don't just describe
+// memBackend's shape. conn/server do not dispatch through Backend or
+// File: they serve *FS directly (see Serve), so a Backend is only
+// reachable by code that calls Attach and the File methods itself.
+type Backend interface {
+	Attach(uname, aname string) (File, error)
+}
+
+// memBackend adapts FS, whose Attach returns the concrete *Fid type
+// for backward compatibility, to the Backend interface.
+type memBackend struct{ fs *FS }
+
+func (b memBackend) Attach(uname, aname string) (File, error) {
+	fid, err := b.fs.Attach(uname, aname)
+	if err != nil {
+		return nil, err
+	}
+	return memFile{fs: b.fs, fid: fid}, nil
+}
+
+// memFile adapts the in-memory *Fid to the File interface. Read/Write
+// go through fs.ReadAt/WriteAt rather than fid.Read/fid.Write directly
+// so a File backed by a BindSocket/BindPipe node behaves the same
+// whether it's reached through *FS or through this interface.
+type memFile struct {
+	fs  *FS
+	fid *Fid
+}
+
+func (f memFile) Walk(names []string) ([]File, error) {
+	fids, err := f.fid.Walk(names)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]File, len(fids))
+	for i, fid := range fids {
+		files[i] = memFile{fs: f.fs, fid: fid}
+	}
+	return files, nil
+}
+
+func (f memFile) Open(mode uint8) error { return f.fid.Open(mode) }
+
+func (f memFile) Create(name string, mode uint8, perm Perm) (File, error) {
+	fid, err := f.fid.Create(name, mode, perm)
+	if err != nil {
+		return nil, err
+	}
+	return memFile{fs: f.fs, fid: fid}, nil
+}
+
+func (f memFile) Read(p []byte, offset int64) (int, error)  { return f.fs.ReadAt(f.fid, p, offset) }
+func (f memFile) Write(p []byte, offset int64) (int, error) { return f.fs.WriteAt(f.fid, p, offset) }
+func (f memFile) Remove() error                             { return f.fid.Remove() }
+func (f memFile) Stat() (plan9.Dir, error)                  { return f.fid.Stat() }
+func (f memFile) Wstat(dir plan9.Dir) error                 { return f.fid.Wstat(dir) }
+func (f memFile) Clunk() error                              { return f.fid.Clunk() }
+
+// Backend returns fs as a Backend. FS.New keeps returning *FS directly
+// so existing callers are unaffected; Backend only matters to code
+// written against the generic interface rather than *FS itself.
+func (fs *FS) Backend() Backend { return memBackend{fs} }
+
+// ROBackend is a read-only Backend over a flat set of named byte
+// blobs, built with nothing borrowed from FS. It attaches to the
+// same root regardless of uname/aname, since a static blob set has no
+// notion of users or multiple trees.
+func ROBackend(files map[string][]byte) Backend {
+	return roBackend{files: files}
+}
+
+type roBackend struct{ files map[string][]byte }
+
+func (b roBackend) Attach(uname, aname string) (File, error) {
+	return roFile{backend: b, name: "/"}, nil
+}
+
+// roFile adapts roBackend's flat map to the File interface. name is
+// always an absolute, cleaned path; "/" is the one directory, every
+// other existing key is a plain file.
+type roFile struct {
+	backend roBackend
+	name    string
+}
+
+func (f roFile) isRoot() bool { return f.name == "/" }
+
+func (f roFile) Walk(names []string) ([]File, error) {
+	files := make([]File, 0, len(names))
+	cur := f.name
+	for _, name := range names {
+		next := path.Join(cur, name)
+		if next != "/" {
+			if _, ok := f.backend.files[next]; !ok {
+				return nil, perror("no such file: " + next)
+			}
+		}
+		files = append(files, roFile{backend: f.backend, name: next})
+		cur = next
+	}
+	return files, nil
+}
+
+func (f roFile) Open(mode uint8) error {
+	if mode&(OWRITE|ORDWR) != 0 {
+		return perror("ROBackend is read-only")
+	}
+	return nil
+}
+
+func (f roFile) Create(name string, mode uint8, perm Perm) (File, error) {
+	return nil, perror("ROBackend is read-only")
+}
+
+func (f roFile) Read(p []byte, offset int64) (int, error) {
+	if f.isRoot() {
+		return 0, perror("is a directory")
+	}
+	content := f.backend.files[f.name]
+	if offset >= int64(len(content)) {
+		return 0, io.EOF
+	}
+	return copy(p, content[offset:]), nil
+}
+
+func (f roFile) Write(p []byte, offset int64) (int, error) {
+	return 0, perror("ROBackend is read-only")
+}
+
+func (f roFile) Remove() error { return perror("ROBackend is read-only") }
+
+func (f roFile) Stat() (plan9.Dir, error) {
+	var dir plan9.Dir
+	dir.Null()
+	if f.isRoot() {
+		dir.Name = "/"
+		dir.Mode = plan9.DMDIR | 0555
+		return dir, nil
+	}
+	dir.Name = path.Base(f.name)
+	dir.Mode = 0444
+	dir.Length = uint64(len(f.backend.files[f.name]))
+	return dir, nil
+}
+
+func (f roFile) Wstat(dir plan9.Dir) error { return perror("ROBackend is read-only") }
+func (f roFile) Clunk() error              { return nil }
+
+// Serve runs the 9P transport against fs, accepting connections on ln
+// until it is closed or Accept fails permanently. It is FS.Listen with
+// an already-bound net.Listener instead of a network/address pair, for
+// callers that need to control how the listener is created (e.g. a
+// unix socket with a particular mode, or a listener handed over by a
+// supervisor).
+//
+// Serve takes *FS rather than Backend on purpose: conn/server still
+// dispatch every request against *node directly, so a Backend that
+// isn't fs's own memory-backed tree has nothing to plug into yet.
+// Making Serve accept Backend without that dispatch work done would
+// promise pluggable transports this tree doesn't deliver.
+func Serve(ln net.Listener, fs *FS) error {
+	return fs.serve(ln)
+}
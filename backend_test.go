@@ -0,0 +1,93 @@
+package ramfs
+
+import (
+	"testing"
+
+	"code.google.com/p/goplan9/plan9"
+)
+
+func TestMemBackendRoundTrip(t *testing.T) {
+	fs := New("glenda")
+	var backend Backend = fs.Backend()
+
+	root, err := backend.Attach("glenda", "")
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	defer root.Clunk()
+
+	f, err := root.Create("hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := f.Write([]byte("hi"), 0); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	f.Clunk()
+
+	files, err := root.Walk([]string{"hello"})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	f = files[0]
+	defer f.Clunk()
+	if err := f.Open(OREAD); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	buf := make([]byte, 2)
+	if _, err := f.Read(buf, 0); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "hi" {
+		t.Errorf("Read = %q, want %q", buf, "hi")
+	}
+}
+
+func TestROBackend(t *testing.T) {
+	var backend Backend = ROBackend(map[string][]byte{
+		"/greeting": []byte("hello from ROBackend"),
+	})
+
+	root, err := backend.Attach("anyone", "")
+	if err != nil {
+		t.Fatalf("Attach: %v", err)
+	}
+	defer root.Clunk()
+
+	dir, err := root.Stat()
+	if err != nil {
+		t.Fatalf("Stat root: %v", err)
+	}
+	if dir.Mode&plan9.DMDIR == 0 {
+		t.Error("root Stat().Mode has no DMDIR bit")
+	}
+
+	files, err := root.Walk([]string{"greeting"})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	f := files[0]
+	defer f.Clunk()
+
+	if err := f.Open(OREAD); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	buf := make([]byte, len("hello from ROBackend"))
+	if _, err := f.Read(buf, 0); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "hello from ROBackend" {
+		t.Errorf("Read = %q, want %q", buf, "hello from ROBackend")
+	}
+
+	if _, err := f.Walk([]string{"missing"}); err == nil {
+		t.Error("Walk to a missing name = nil error, want error")
+	}
+
+	if err := f.Open(OWRITE); err == nil {
+		t.Error("Open(OWRITE) on ROBackend = nil error, want error")
+	}
+	if _, err := root.Create("new", OWRITE, Perm(0644)); err == nil {
+		t.Error("Create on ROBackend = nil error, want error")
+	}
+}
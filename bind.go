@@ -0,0 +1,167 @@
+package ramfs
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"code.google.com/p/goplan9/plan9"
+)
+
+// endpoint is the backing object for a node created by BindSocket or
+// BindPipe. FS.ReadAt/WriteAt check fs.endpoint(fid.node) before falling
+// back to fid.Read/fid.Write, so reads and writes on a bound fid are
+// forwarded to it instead of served from the node's in-memory block
+// list.
+type endpoint interface {
+	io.Reader
+	io.Writer
+}
+
+func (fs *FS) endpoint(n *node) (endpoint, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	e, ok := fs.endpoints[n]
+	return e, ok
+}
+
+func (fs *FS) setEndpoint(n *node, e endpoint) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.endpoints[n] = e
+}
+
+// ReadAt reads from fid, forwarding to its bound endpoint when fid was
+// opened on a node created by BindSocket or BindPipe, and falling back
+// to fid.Read otherwise. offset is ignored for an endpoint-backed fid:
+// a socket or pipe has no notion of a read position.
+func (fs *FS) ReadAt(fid *Fid, p []byte, offset int64) (int, error) {
+	if e, ok := fs.endpoint(fid.node); ok {
+		return e.Read(p)
+	}
+	return fid.Read(p, offset)
+}
+
+// WriteAt is the write-side counterpart of ReadAt.
+func (fs *FS) WriteAt(fid *Fid, p []byte, offset int64) (int, error) {
+	if e, ok := fs.endpoint(fid.node); ok {
+		return e.Write(p)
+	}
+	return fid.Write(p, offset)
+}
+
+// pipeEndpoint joins a separate reader and writer into a single
+// endpoint, for BindPipe where the two directions are not the same
+// object (e.g. the two ends of an os.Pipe, or stdin/stdout of a
+// subprocess).
+type pipeEndpoint struct {
+	r io.Reader
+	w io.Writer
+}
+
+func (p pipeEndpoint) Read(b []byte) (int, error)  { return p.r.Read(b) }
+func (p pipeEndpoint) Write(b []byte) (int, error) { return p.w.Write(b) }
+
+// SetDeadline implements deadliner (see context.go) for the subset of
+// readers/writers that support it themselves (e.g. the two ends of an
+// os.Pipe), so ReadContext/WriteContext can interrupt a blocked call on
+// a bound pipe instead of only being able to stop waiting on it.
+// Readers/writers that don't support a deadline are left alone; ctx
+// cancellation then has nothing to interrupt them with.
+func (p pipeEndpoint) SetDeadline(t time.Time) error {
+	var err error
+	if dr, ok := p.r.(interface{ SetReadDeadline(time.Time) error }); ok {
+		if e := dr.SetReadDeadline(t); e != nil {
+			err = e
+		}
+	}
+	if dw, ok := p.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		if e := dw.SetWriteDeadline(t); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// socketEndpoint forwards to the first connection accepted off ln,
+// accepted lazily so the node can exist before any client has
+// connected to it.
+type socketEndpoint struct {
+	ln net.Listener
+
+	mu sync.Mutex
+	c  net.Conn
+}
+
+func (s *socketEndpoint) conn() (net.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.c != nil {
+		return s.c, nil
+	}
+	c, err := s.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	s.c = c
+	return c, nil
+}
+
+func (s *socketEndpoint) Read(b []byte) (int, error) {
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	return c.Read(b)
+}
+
+func (s *socketEndpoint) Write(b []byte) (int, error) {
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	return c.Write(b)
+}
+
+// SetDeadline implements deadliner (see context.go). It only touches a
+// connection that has already been accepted; a fid blocked waiting for
+// Accept itself isn't interrupted by it, the same limitation Read/Write
+// already have against an endpoint with no connection yet.
+func (s *socketEndpoint) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	c := s.c
+	s.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+	return c.SetDeadline(t)
+}
+
+// BindSocket creates path as a DMDEVICE node backed by ln: reads and
+// writes on a fid opened at path are forwarded to the first connection
+// ln accepts rather than served from the in-memory block list. This
+// turns ramfs into a plausible control-plane surface -- publish a
+// listener at /net/ctl and let 9P clients open it as a file.
+func (fs *FS) BindSocket(path string, ln net.Listener) error {
+	fid, err := fs.Create(path, OREAD|OWRITE, Perm(0660)|Perm(plan9.DMDEVICE))
+	if err != nil {
+		return err
+	}
+	defer fid.Clunk()
+	fs.setEndpoint(fid.node, &socketEndpoint{ln: ln})
+	return nil
+}
+
+// BindPipe creates path as a named-pipe node backed by r and w: reads
+// and writes on a fid opened at path are forwarded to r/w instead of
+// the in-memory block list.
+func (fs *FS) BindPipe(path string, r io.Reader, w io.Writer) error {
+	fid, err := fs.Create(path, OREAD|OWRITE, Perm(0660)|Perm(plan9.DMNAMEDPIPE))
+	if err != nil {
+		return err
+	}
+	defer fid.Clunk()
+	fs.setEndpoint(fid.node, pipeEndpoint{r: r, w: w})
+	return nil
+}
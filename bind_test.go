@@ -0,0 +1,37 @@
+package ramfs
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBindPipeForwards(t *testing.T) {
+	fs := New("glenda")
+
+	r := bytes.NewBufferString("hello from the pipe")
+	var w bytes.Buffer
+	if err := fs.BindPipe("/ctl", r, &w); err != nil {
+		t.Fatalf("BindPipe: %v", err)
+	}
+
+	fid, err := fs.Open("/ctl", OREAD|OWRITE)
+	if err != nil {
+		t.Fatalf("Open /ctl: %v", err)
+	}
+	defer fid.Clunk()
+
+	buf := make([]byte, len("hello from the pipe"))
+	if _, err := fs.ReadAt(fid, buf, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if got, want := string(buf), "hello from the pipe"; got != want {
+		t.Errorf("ReadAt = %q, want %q (read did not reach the bound endpoint)", got, want)
+	}
+
+	if _, err := fs.WriteAt(fid, []byte("reply"), 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+	if got, want := w.String(), "reply"; got != want {
+		t.Errorf("pipe write side = %q, want %q (write did not reach the bound endpoint)", got, want)
+	}
+}
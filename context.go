@@ -0,0 +1,182 @@
+package ramfs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flushTable tracks the context.CancelFunc for each ReadContext/
+// WriteContext call still in flight, keyed by *Fid rather than by a 9P
+// tag: FS.Flush names the Fid a blocked call was issued against. conn's
+// Tflush handling does not call FS.Flush, so only callers of
+// ReadContext/WriteContext can cancel through this table. A fid can
+// have more than one call in flight at once
+// (pipelined Tread/Twrite with distinct tags on the same fid is legal
+// 9P), so entries are tracked per-registration rather than one cancel
+// slot per fid: a second concurrent call on the same fid must not
+// clobber the first's cancel func, and letting one call's done() run
+// must not delete the other's still-live entry.
+type flushTable struct {
+	mu     sync.Mutex
+	cancel map[*Fid]map[*registration]struct{}
+}
+
+type registration struct {
+	cancel context.CancelFunc
+}
+
+func newFlushTable() *flushTable {
+	return &flushTable{cancel: make(map[*Fid]map[*registration]struct{})}
+}
+
+// register derives a cancelable ctx from parent for one call on fid.
+// The caller must invoke the returned done once the call has returned,
+// whether or not it was flushed; done both removes this call's own
+// entry (and only this one) and cancels ctx.
+func (t *flushTable) register(fid *Fid, parent context.Context) (ctx context.Context, done func()) {
+	ctx, cancel := context.WithCancel(parent)
+	reg := &registration{cancel: cancel}
+
+	t.mu.Lock()
+	if t.cancel[fid] == nil {
+		t.cancel[fid] = make(map[*registration]struct{})
+	}
+	t.cancel[fid][reg] = struct{}{}
+	t.mu.Unlock()
+
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.cancel[fid], reg)
+		if len(t.cancel[fid]) == 0 {
+			delete(t.cancel, fid)
+		}
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// flush cancels every ctx currently registered for fid. There is no
+// per-tag granularity at this level (see the flushTable doc comment),
+// so flushing a fid flushes everything in flight on it, which is the
+// closest available match to a real Tflush's "cancel this one request"
+// semantics.
+func (t *flushTable) flush(fid *Fid) {
+	t.mu.Lock()
+	regs := make([]*registration, 0, len(t.cancel[fid]))
+	for r := range t.cancel[fid] {
+		regs = append(regs, r)
+	}
+	t.mu.Unlock()
+
+	for _, r := range regs {
+		r.cancel()
+	}
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+// deadliner is implemented by an endpoint (see bind.go) whose blocking
+// Read/Write can be bounded by a deadline, the way net.Conn already
+// can. ReadContext/WriteContext use it to really interrupt I/O in
+// flight on ctx cancellation -- setting a deadline in the past forces
+// the blocked call to return immediately -- rather than merely
+// abandoning the wait for it, which would leak the call and let it
+// race a later legitimate Tread/Twrite on the same fid.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// canceledDeadline is passed to SetDeadline to interrupt a blocked
+// Read/Write; any time in the past has the same effect.
+var canceledDeadline = time.Unix(0, 1)
+
+// ReadContext is fid.Read (by way of fs.ReadAt) bounded by ctx. If
+// fid's node is bound to an endpoint that supports deadlines (see
+// BindSocket/BindPipe), ctx cancellation sets a past deadline on it to
+// actually interrupt a blocked Read; it always waits for that Read to
+// return before reporting back, so Rflush-equivalent bookkeeping (the
+// deferred done() below) only happens once the underlying call has
+// actually acknowledged, never while it's still running.
+func (fs *FS) ReadContext(ctx context.Context, fid *Fid, p []byte, offset int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	ctx, done := fs.flush.register(fid, ctx)
+	defer done()
+
+	var dl deadliner
+	if e, ok := fs.endpoint(fid.node); ok {
+		dl, _ = e.(deadliner)
+	}
+	if dl == nil {
+		// Nothing to interrupt: an in-memory read never blocks, so there
+		// is nothing ctx cancellation needs to race against.
+		return fs.ReadAt(fid, p, offset)
+	}
+
+	result := make(chan readResult, 1)
+	go func() {
+		n, err := fs.ReadAt(fid, p, offset)
+		result <- readResult{n, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.n, r.err
+	case <-ctx.Done():
+		dl.SetDeadline(canceledDeadline)
+		r := <-result
+		dl.SetDeadline(time.Time{})
+		if r.err == nil {
+			return r.n, nil
+		}
+		return 0, ctx.Err()
+	}
+}
+
+// WriteContext is the write-side counterpart of ReadContext.
+func (fs *FS) WriteContext(ctx context.Context, fid *Fid, p []byte, offset int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	ctx, done := fs.flush.register(fid, ctx)
+	defer done()
+
+	var dl deadliner
+	if e, ok := fs.endpoint(fid.node); ok {
+		dl, _ = e.(deadliner)
+	}
+	if dl == nil {
+		return fs.WriteAt(fid, p, offset)
+	}
+
+	result := make(chan readResult, 1)
+	go func() {
+		n, err := fs.WriteAt(fid, p, offset)
+		result <- readResult{n, err}
+	}()
+
+	select {
+	case r := <-result:
+		return r.n, r.err
+	case <-ctx.Done():
+		dl.SetDeadline(canceledDeadline)
+		r := <-result
+		dl.SetDeadline(time.Time{})
+		if r.err == nil {
+			return r.n, nil
+		}
+		return 0, ctx.Err()
+	}
+}
+
+// Flush cancels every ReadContext/WriteContext call currently in
+// flight on fid, the way a server's Tflush handler cancels whichever
+// Tread or Twrite the flushed tag named.
+func (fs *FS) Flush(fid *Fid) {
+	fs.flush.flush(fid)
+}
@@ -0,0 +1,93 @@
+package ramfs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestReadContextCanceled(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.Create("/hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create /hello: %v", err)
+	}
+	defer fid.Clunk()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := fs.ReadContext(ctx, fid, make([]byte, 1), 0); err != context.Canceled {
+		t.Fatalf("ReadContext with canceled ctx = %v, want context.Canceled", err)
+	}
+}
+
+// TestFlushUnblocksRead binds a fid to one end of a net.Pipe (which,
+// like BindPipe's motivating os.Pipe case, implements a real blocking
+// Read with a deadline) and never writes to the other end, so the
+// ReadContext call genuinely blocks. It then confirms FS.Flush actually
+// interrupts that blocked call instead of merely giving up on waiting
+// for it.
+func TestFlushUnblocksRead(t *testing.T) {
+	fs := New("glenda")
+	a, b := net.Pipe()
+	defer b.Close()
+
+	if err := fs.BindPipe("/ctl", a, a); err != nil {
+		t.Fatalf("BindPipe: %v", err)
+	}
+	fid, err := fs.Open("/ctl", OREAD|OWRITE)
+	if err != nil {
+		t.Fatalf("Open /ctl: %v", err)
+	}
+	defer fid.Clunk()
+
+	started := make(chan struct{})
+	errc := make(chan error, 1)
+	go func() {
+		close(started)
+		_, err := fs.ReadContext(context.Background(), fid, make([]byte, 1), 0)
+		errc <- err
+	}()
+	<-started
+	time.Sleep(20 * time.Millisecond) // let ReadContext actually reach the blocking Read
+
+	fs.Flush(fid)
+
+	select {
+	case err := <-errc:
+		if err != context.Canceled {
+			t.Fatalf("ReadContext after Flush = %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Flush did not unblock the in-flight ReadContext")
+	}
+}
+
+func TestFlushTableDoesNotClobberConcurrentRegistrations(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.Create("/hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer fid.Clunk()
+
+	parent := context.Background()
+	ctx1, done1 := fs.flush.register(fid, parent)
+	ctx2, done2 := fs.flush.register(fid, parent)
+
+	done1() // must only cancel ctx1's own registration
+	if ctx1.Err() == nil {
+		t.Error("ctx1.Err() = nil after its own done(), want canceled")
+	}
+	if ctx2.Err() != nil {
+		t.Errorf("ctx2.Err() = %v after ctx1's done(), want nil (still live)", ctx2.Err())
+	}
+
+	fs.flush.flush(fid) // must still reach ctx2
+	if ctx2.Err() == nil {
+		t.Error("ctx2.Err() = nil after Flush, want canceled")
+	}
+	done2()
+}
@@ -0,0 +1,394 @@
+package ramfs
+
+import (
+	"context"
+	"encoding/binary"
+	"path"
+	"sort"
+
+	"code.google.com/p/goplan9/plan9"
+)
+
+// 9P2000.L is the Linux-flavored 9P dialect spoken by the Linux v9fs
+// client when mounted with "-o version=9p2000.L" (see
+// Documentation/filesystems/9p.txt in the Linux kernel tree). Unlike
+// plain 9P2000 it carries POSIX open(2)/stat(2) semantics directly on
+// the wire instead of going through Twalk/Topen/Tcreate and plan9.Dir.
+//
+// Everything below this point only translates between the 9P2000.L
+// request fields and the existing OREAD/OWRITE/... and node/Fid
+// machinery, it does not duplicate it. conn does not negotiate the
+// dialect in Tversion or dispatch 9P2000.L messages to these methods;
+// it keeps no dialect on the connection.
+
+// Recognized Tversion strings.
+const (
+	Version9P2000  = "9P2000"
+	Version9P2000L = "9P2000.L"
+)
+
+// dotlVersion reports whether uname is one of the two dialects ramfs
+// knows how to speak, 9P2000 or 9P2000.L, and returns the string
+// Tversion should echo back in Rversion. Only those two exact strings
+// are recognized.
+func dotlVersion(uname string) (string, bool) {
+	switch uname {
+	case Version9P2000:
+		return Version9P2000, true
+	case Version9P2000L:
+		return Version9P2000L, true
+	}
+	return "", false
+}
+
+// Linux open(2)/fcntl.h flag bits as carried by Tlopen/Tlcreate. These
+// are the generic Linux ABI values v9fs sends on the wire regardless
+// of the client's own architecture.
+const (
+	LORDONLY    = 0x00000000
+	LOWRONLY    = 0x00000001
+	LORDWR      = 0x00000002
+	LOCREAT     = 0x00000040
+	LOEXCL      = 0x00000080
+	LOTRUNC     = 0x00000200
+	LOAPPEND    = 0x00000400
+	LODIRECTORY = 0x00010000
+	LONOFOLLOW  = 0x00020000
+)
+
+// lflags translates the POSIX flags of a Tlopen/Tlcreate request into
+// the OREAD/OWRITE/OTRUNC/OEXCL/OAPPEND bits Fid.Open and dir.Create
+// already understand. ORCLOSE has no Linux flag equivalent; it is set
+// by the remove-on-close path, not by lflags.
+func lflags(flags uint32) uint8 {
+	var mode uint8
+	switch flags & 3 {
+	case LOWRONLY:
+		mode = OWRITE
+	case LORDWR:
+		mode = ORDWR
+	default:
+		mode = OREAD
+	}
+	if flags&LOTRUNC != 0 {
+		mode |= OTRUNC
+	}
+	if flags&LOEXCL != 0 {
+		mode |= OEXCL
+	}
+	if flags&LOAPPEND != 0 {
+		mode |= OAPPEND
+	}
+	return mode
+}
+
+// Tgetattr/Rgetattr and Tsetattr valid masks, selecting which of the
+// stat fields below are meaningful on the wire.
+const (
+	GetattrMode = 1 << iota
+	GetattrNlink
+	GetattrUID
+	GetattrGID
+	GetattrRdev
+	GetattrAtime
+	GetattrMtime
+	GetattrCtime
+	GetattrIno
+	GetattrSize
+	GetattrBlocks
+	GetattrBtime
+	GetattrGen
+	GetattrDataVersion
+	GetattrBasic = GetattrMode | GetattrNlink | GetattrUID | GetattrGID |
+		GetattrRdev | GetattrAtime | GetattrMtime | GetattrCtime |
+		GetattrIno | GetattrSize | GetattrBlocks
+	GetattrAll = GetattrBasic | GetattrBtime | GetattrGen | GetattrDataVersion
+)
+
+const (
+	SetattrMode = 1 << iota
+	SetattrUID
+	SetattrGID
+	SetattrSize
+	SetattrAtime
+	SetattrMtime
+	SetattrCtime
+	SetattrAtimeSet
+	SetattrMtimeSet
+)
+
+// dirent is one entry of an Rreaddir reply, packed on the wire as
+// qid[13] offset[8] type[1] name[s] and repeated until the reply hits
+// the requested count.
+type dirent struct {
+	qid    plan9.Qid
+	offset uint64
+	etype  uint8
+	name   string
+}
+
+func (d dirent) marshal() []byte {
+	b := make([]byte, 13+8+1+2+len(d.name))
+	b[0] = d.qid.Type
+	binary.LittleEndian.PutUint32(b[1:5], d.qid.Version)
+	binary.LittleEndian.PutUint64(b[5:13], d.qid.Path)
+	binary.LittleEndian.PutUint64(b[13:21], d.offset)
+	b[21] = d.etype
+	binary.LittleEndian.PutUint16(b[22:24], uint16(len(d.name)))
+	copy(b[24:], d.name)
+	return b
+}
+
+// statfs mirrors the fields of Linux's struct statfs, as returned by
+// Tstatfs. ramfs has no notion of block devices or free space beyond
+// its in-memory allocator, so Bfree/Bavail/Ffree are best-effort.
+type statfs struct {
+	Type    uint32
+	Bsize   uint32
+	Blocks  uint64
+	Bfree   uint64
+	Bavail  uint64
+	Files   uint64
+	Ffree   uint64
+	Fsid    uint64
+	Namelen uint32
+}
+
+// Version negotiates the dialect for a new connection: it normalizes
+// uname to the canonical string and caps msize to MSIZE, the same
+// capping plain 9P2000 Tversion already does. conn does not call
+// Version and keeps no dialect on its per-connection state.
+func (fs *FS) Version(uname string, msize uint32) (string, uint32, error) {
+	v, ok := dotlVersion(uname)
+	if !ok {
+		return "", 0, perror("unknown 9P version: " + uname)
+	}
+	if msize > MSIZE {
+		msize = MSIZE
+	}
+	return v, msize, nil
+}
+
+// OpenL is Tlopen translated into OpenContext/CreateContext: flags are
+// POSIX open(2) bits instead of an OREAD/OWRITE/... byte, and LOCREAT
+// makes it behave like Tlcreate instead of failing when name does not
+// exist yet.
+func (fs *FS) OpenL(ctx context.Context, name string, flags uint32, mode uint32) (*Fid, error) {
+	if flags&LOCREAT != 0 {
+		return fs.CreateContext(ctx, name, lflags(flags), Perm(mode)&0777)
+	}
+	return fs.OpenContext(ctx, name, lflags(flags))
+}
+
+// MkdirL is Tmkdir: create name as a directory with the given POSIX
+// permission bits.
+func (fs *FS) MkdirL(ctx context.Context, name string, mode uint32) (*Fid, error) {
+	return fs.CreateContext(ctx, name, OREAD, Perm(mode)&0777|Perm(plan9.DMDIR))
+}
+
+// SymlinkL is Tsymlink: create name as a DMSYMLINK node whose content
+// is target, the same representation ImportTar already uses for tar
+// symlinks.
+func (fs *FS) SymlinkL(ctx context.Context, name, target string) error {
+	fid, err := fs.CreateContext(ctx, name, OWRITE, Perm(0777)|Perm(plan9.DMSYMLINK))
+	if err != nil {
+		return err
+	}
+	defer fid.Clunk()
+	_, err = fid.Write([]byte(target), 0)
+	return err
+}
+
+// ReadlinkL is Treadlink, the inverse of SymlinkL.
+func (fs *FS) ReadlinkL(ctx context.Context, name string) (string, error) {
+	fid, err := fs.OpenContext(ctx, name, OREAD)
+	if err != nil {
+		return "", err
+	}
+	defer fid.Clunk()
+
+	buf := make([]byte, IOUNIT)
+	n, err := fid.Read(buf, 0)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// UnlinkatL is Tunlinkat: remove name relative to dirname.
+func (fs *FS) UnlinkatL(ctx context.Context, dirname, name string) error {
+	return fs.RemoveContext(ctx, path.Join(dirname, name))
+}
+
+// RenameL is Trename/Trenameat for a plain file: ramfs has no atomic
+// rename of its own, so this is copy-then-remove rather than an
+// in-place link update.
+func (fs *FS) RenameL(ctx context.Context, oldname, newname string) error {
+	old, err := fs.OpenContext(ctx, oldname, OREAD)
+	if err != nil {
+		return err
+	}
+	dir, err := old.Stat()
+	if err != nil {
+		old.Clunk()
+		return err
+	}
+	if dir.Mode&plan9.DMDIR != 0 {
+		old.Clunk()
+		return perror("RenameL: directory rename not supported")
+	}
+
+	nfid, err := fs.CreateContext(ctx, newname, OWRITE|OTRUNC, Perm(dir.Mode)&0777)
+	if err != nil {
+		old.Clunk()
+		return err
+	}
+
+	buf := make([]byte, IOUNIT)
+	var off int64
+	for {
+		n, rerr := old.Read(buf, off)
+		if n > 0 {
+			if _, werr := nfid.Write(buf[:n], off); werr != nil {
+				old.Clunk()
+				nfid.Clunk()
+				return werr
+			}
+			off += int64(n)
+		}
+		if rerr != nil || n == 0 {
+			break
+		}
+	}
+	old.Clunk()
+	nfid.Clunk()
+	return fs.RemoveContext(ctx, oldname)
+}
+
+// RenameatL is Trenameat: RenameL with both paths resolved relative to
+// a directory.
+func (fs *FS) RenameatL(ctx context.Context, olddir, oldname, newdir, newname string) error {
+	return fs.RenameL(ctx, path.Join(olddir, oldname), path.Join(newdir, newname))
+}
+
+// GetattrL is Tgetattr: translate a Stat into the subset of fields
+// valid selects. ramfs tracks none of nlink/rdev/btime/gen/data-version
+// beyond what plan9.Dir already carries, so those bits of GetattrAll
+// are never actually set.
+func (fs *FS) GetattrL(fid *Fid, valid uint64) (plan9.Dir, uint64, error) {
+	dir, err := fid.Stat()
+	if err != nil {
+		return plan9.Dir{}, 0, err
+	}
+	return dir, valid & GetattrBasic &^ (GetattrNlink | GetattrRdev), nil
+}
+
+// SetattrL is Tsetattr: apply only the fields valid selects, leaving
+// the rest untouched via plan9.Dir.Null's wildcard values. uid/gid are
+// names resolved against fs.group, the same as Wstat already expects
+// for plain 9P2000's Twstat.
+func (fs *FS) SetattrL(fid *Fid, valid uint32, mode uint32, uid, gid string, atime, mtime uint32, size uint64) error {
+	var dir plan9.Dir
+	dir.Null()
+	if valid&SetattrMode != 0 {
+		dir.Mode = plan9.Perm(mode)
+	}
+	if valid&SetattrUID != 0 {
+		if _, err := fs.group.Get(uid); err != nil {
+			return err
+		}
+		dir.Uid = uid
+	}
+	if valid&SetattrGID != 0 {
+		if _, err := fs.group.Get(gid); err != nil {
+			return err
+		}
+		dir.Gid = gid
+	}
+	if valid&(SetattrAtime|SetattrAtimeSet) != 0 {
+		dir.Atime = atime
+	}
+	if valid&(SetattrMtime|SetattrMtimeSet) != 0 {
+		dir.Mtime = mtime
+	}
+	if valid&SetattrSize != 0 {
+		dir.Length = size
+	}
+	return fid.Wstat(dir)
+}
+
+// StatfsL is Tstatfs. ramfs has no block device or free-space notion
+// beyond its in-memory qid allocator, so Bfree/Bavail/Ffree only
+// reflect how many qid paths are still available below maxPath.
+func (fs *FS) StatfsL() statfs {
+	fs.mu.Lock()
+	free := maxPath - fs.path + uint64(len(fs.pathmap))
+	fs.mu.Unlock()
+
+	return statfs{
+		Type:    0x01021997, // V9FS_MAGIC
+		Bsize:   BLOCKSIZE,
+		Blocks:  free,
+		Bfree:   free,
+		Bavail:  free,
+		Files:   free,
+		Ffree:   free,
+		Namelen: 256,
+	}
+}
+
+// XattrwalkL and XattrgetL are Txattrwalk/Txattrget: ramfs has no
+// extended attributes, so both report "no xattr" the way a real
+// filesystem reports ENODATA for a name it does not recognize.
+func (fs *FS) XattrwalkL(fid *Fid, name string) error {
+	return perror("no xattr")
+}
+
+func (fs *FS) XattrgetL(fid *Fid, name string) ([]byte, error) {
+	return nil, perror("no xattr")
+}
+
+// ReaddirL is Treaddir: pack dirname's children into the wire format,
+// starting after offset and stopping once the packed bytes would
+// exceed count.
+func (fs *FS) ReaddirL(dirname string, offset uint64, count int) ([]byte, error) {
+	n, err := fs.walk(dirname)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := make([]byte, 0, count)
+	for i, name := range names {
+		if uint64(i) < offset {
+			continue
+		}
+
+		full := path.Join(dirname, name)
+		fid, err := fs.Open(full, OREAD)
+		if err != nil {
+			return nil, err
+		}
+		dir, err := fid.Stat()
+		fid.Clunk()
+		if err != nil {
+			return nil, err
+		}
+
+		etype := uint8(0) // DT_UNKNOWN; v9fs falls back to Getattr
+		if dir.Mode&plan9.DMDIR != 0 {
+			etype = 4 // DT_DIR
+		}
+		b := dirent{qid: dir.Qid, offset: uint64(i + 1), etype: etype, name: name}.marshal()
+		if len(buf)+len(b) > count {
+			break
+		}
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
@@ -0,0 +1,206 @@
+package ramfs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLflags(t *testing.T) {
+	cases := []struct {
+		flags uint32
+		want  uint8
+	}{
+		{LORDONLY, OREAD},
+		{LOWRONLY, OWRITE},
+		{LORDWR, ORDWR},
+		{LOWRONLY | LOTRUNC, OWRITE | OTRUNC},
+		{LORDONLY | LOEXCL, OREAD | OEXCL},
+		{LOWRONLY | LOAPPEND, OWRITE | OAPPEND},
+	}
+	for _, c := range cases {
+		if got := lflags(c.flags); got != c.want {
+			t.Errorf("lflags(%#x) = %#x, want %#x", c.flags, got, c.want)
+		}
+	}
+}
+
+func TestDotlVersion(t *testing.T) {
+	if v, ok := dotlVersion(Version9P2000L); !ok || v != Version9P2000L {
+		t.Errorf("dotlVersion(%q) = %q, %v", Version9P2000L, v, ok)
+	}
+	if v, ok := dotlVersion(Version9P2000); !ok || v != Version9P2000 {
+		t.Errorf("dotlVersion(%q) = %q, %v", Version9P2000, v, ok)
+	}
+	if _, ok := dotlVersion("9P3000"); ok {
+		t.Errorf("dotlVersion(%q) = ok, want not ok", "9P3000")
+	}
+}
+
+func TestOpenLCreat(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.OpenL(context.Background(), "/hello", LOWRONLY|LOCREAT, 0644)
+	if err != nil {
+		t.Fatalf("OpenL LOCREAT: %v", err)
+	}
+	if _, err := fid.Write([]byte("hi"), 0); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	fid.Clunk()
+
+	fid, err = fs.OpenL(context.Background(), "/hello", LORDONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenL LORDONLY: %v", err)
+	}
+	defer fid.Clunk()
+	buf := make([]byte, 2)
+	if _, err := fid.Read(buf, 0); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "hi" {
+		t.Errorf("Read = %q, want %q", buf, "hi")
+	}
+}
+
+func TestSetattrLChown(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.Create("/hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer fid.Clunk()
+
+	err = fs.SetattrL(fid, SetattrUID|SetattrGID, 0, "glenda", "glenda", 0, 0, 0)
+	if err != nil {
+		t.Fatalf("SetattrL chown: %v", err)
+	}
+
+	dir, err := fid.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if dir.Uid != "glenda" || dir.Gid != "glenda" {
+		t.Errorf("Stat uid/gid = %q/%q, want glenda/glenda", dir.Uid, dir.Gid)
+	}
+
+	if err := fs.SetattrL(fid, SetattrUID, 0, "nobody-such-user", "", 0, 0, 0); err == nil {
+		t.Error("SetattrL with unknown uid = nil error, want error")
+	}
+}
+
+func TestSetattrLMaskedFieldsUntouched(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.Create("/hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer fid.Clunk()
+
+	before, err := fid.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	if err := fs.SetattrL(fid, SetattrMtime, 0, "", "", 0, 12345, 0); err != nil {
+		t.Fatalf("SetattrL mtime: %v", err)
+	}
+
+	after, err := fid.Stat()
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if after.Mtime != 12345 {
+		t.Errorf("Mtime = %d, want 12345", after.Mtime)
+	}
+	if after.Mode != before.Mode {
+		t.Errorf("Mode changed to %v, want untouched %v", after.Mode, before.Mode)
+	}
+}
+
+func TestReaddirLPacksEntries(t *testing.T) {
+	fs := New("glenda")
+	if _, err := fs.Create("/a", OWRITE, Perm(0644)); err != nil {
+		t.Fatalf("Create /a: %v", err)
+	}
+	if _, err := fs.Create("/b", OWRITE, Perm(0644)); err != nil {
+		t.Fatalf("Create /b: %v", err)
+	}
+
+	buf, err := fs.ReaddirL("/", 0, IOUNIT)
+	if err != nil {
+		t.Fatalf("ReaddirL: %v", err)
+	}
+	if len(buf) == 0 {
+		t.Fatal("ReaddirL returned no entries")
+	}
+
+	// Every entry must parse back out cleanly: qid[13] offset[8] type[1] namelen[2] name.
+	var names []string
+	for len(buf) > 0 {
+		if len(buf) < 24 {
+			t.Fatalf("truncated dirent header, %d bytes left", len(buf))
+		}
+		namelen := int(buf[22]) | int(buf[23])<<8
+		if len(buf) < 24+namelen {
+			t.Fatalf("truncated dirent name, want %d bytes, have %d", namelen, len(buf)-24)
+		}
+		names = append(names, string(buf[24:24+namelen]))
+		buf = buf[24+namelen:]
+	}
+
+	found := map[string]bool{}
+	for _, n := range names {
+		found[n] = true
+	}
+	if !found["a"] || !found["b"] {
+		t.Errorf("ReaddirL entries = %v, want a and b", names)
+	}
+}
+
+func TestRenameLCopiesAndRemoves(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.Create("/old", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create /old: %v", err)
+	}
+	if _, err := fid.Write([]byte("payload"), 0); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	fid.Clunk()
+
+	if err := fs.RenameL(context.Background(), "/old", "/new"); err != nil {
+		t.Fatalf("RenameL: %v", err)
+	}
+
+	if _, err := fs.Open("/old", OREAD); err == nil {
+		t.Error("/old still exists after RenameL")
+	}
+
+	fid, err = fs.Open("/new", OREAD)
+	if err != nil {
+		t.Fatalf("Open /new: %v", err)
+	}
+	defer fid.Clunk()
+	buf := make([]byte, len("payload"))
+	if _, err := fid.Read(buf, 0); err != nil {
+		t.Fatalf("Read /new: %v", err)
+	}
+	if string(buf) != "payload" {
+		t.Errorf("/new content = %q, want %q", buf, "payload")
+	}
+}
+
+func TestXattrLReportsNoXattr(t *testing.T) {
+	fs := New("glenda")
+	fid, err := fs.Create("/hello", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer fid.Clunk()
+
+	if err := fs.XattrwalkL(fid, "user.foo"); err == nil {
+		t.Error("XattrwalkL = nil error, want error")
+	}
+	if _, err := fs.XattrgetL(fid, "user.foo"); err == nil {
+		t.Error("XattrgetL = nil error, want error")
+	}
+}
@@ -23,6 +23,7 @@ References:
 package ramfs
 
 import (
+	"context"
 	"net"
 	"path"
 	"strings"
@@ -66,13 +67,24 @@ const (
 
 type LogFunc func(format string, v ...interface{})
 
+// tree is one independently rooted file hierarchy exported under an
+// aname. Each tree owns its own /adm/ctl and /adm/group node so that
+// permission changes made through one aname can never affect another.
+type tree struct {
+	root  *node
+	group *group
+}
+
 type FS struct {
-	mu        sync.Mutex
+	mu        *sync.Mutex
 	path      uint64
 	pathmap   map[uint64]bool
 	fidnew    chan (chan *Fid)
 	root      *node
 	group     *group
+	trees     map[string]*tree
+	endpoints map[*node]endpoint // nodes bound with BindSocket/BindPipe
+	flush     *flushTable
 	hostowner string
 	chatty    bool // not sync'd
 	Log       LogFunc
@@ -93,17 +105,40 @@ func New(hostowner string) *FS {
 		owner = "adm"
 	}
 	fs := &FS{
+		mu:        new(sync.Mutex),
 		path:      uint64(4),
 		pathmap:   make(map[uint64]bool),
 		fidnew:    make(chan (chan *Fid)),
-		group:     newGroup(owner),
+		trees:     make(map[string]*tree),
+		endpoints: make(map[*node]endpoint),
+		flush:     newFlushTable(),
 		hostowner: owner,
 	}
 
-	root := newNode(fs, "/", owner, "adm", 0755|plan9.DMDIR, 0, nil)
-	adm := newNode(fs, "adm", "adm", "adm", 0770|plan9.DMDIR, 1, nil)
-	group := newNode(fs, "group", "adm", "adm", 0660, 2, fs.group)
-	ctl := newNode(fs, "ctl", "adm", "adm", 0220, 3, newCtl(fs))
+	t := fs.newTree(owner, 0, 1, 2, 3)
+	fs.root = t.root
+	fs.group = t.group
+	fs.trees[""] = t
+
+	go fs.newFid(fs.fidnew)
+	return fs
+}
+
+// newTree builds a fresh root/adm/group/ctl hierarchy owned by owner.
+// The qid path numbers are supplied by the caller so New can keep the
+// historical 0-3 numbering while Mount draws fresh ones from newPath.
+func (fs *FS) newTree(owner string, rootPath, admPath, groupPath, ctlPath uint64) *tree {
+	grp := newGroup(owner)
+	root := newNode(fs, "/", owner, "adm", 0755|plan9.DMDIR, rootPath, nil)
+	adm := newNode(fs, "adm", "adm", "adm", 0770|plan9.DMDIR, admPath, nil)
+	group := newNode(fs, "group", "adm", "adm", 0660, groupPath, grp)
+
+	// newCtl only takes an *FS, and looks at its root/group/hostowner
+	// fields to decide what a ctl command is allowed to touch. Handing
+	// it fs directly would make every tree's ctl operate on whichever
+	// tree fs.root/fs.group happen to point at (the default tree), so
+	// ctl gets a scoped view of just this tree instead.
+	ctl := newNode(fs, "ctl", "adm", "adm", 0220, ctlPath, newCtl(fs.scopedTo(owner, root, grp)))
 
 	root.children["adm"] = adm
 	adm.children["group"] = group
@@ -113,9 +148,70 @@ func New(hostowner string) *FS {
 	group.parent = adm
 	ctl.parent = adm
 
-	fs.root = root
-	go fs.newFid(fs.fidnew)
-	return fs
+	return &tree{root: root, group: grp}
+}
+
+// scopedTo returns a shallow copy of fs for a single tree's ctl node.
+// It shares the mutex, the freed-path map and the fid source with fs;
+// the path counter and Log are copied as they are at the time of the
+// call, so later changes to them on either side are not seen by the
+// other. root/group/hostowner are overridden so ctl commands issued
+// through this tree's /adm/ctl can never reach another mounted aname.
+func (fs *FS) scopedTo(owner string, root *node, group *group) *FS {
+	cp := *fs
+	cp.root = root
+	cp.group = group
+	cp.hostowner = owner
+	return &cp
+}
+
+// Mount registers an additional file tree under aname, owned by owner,
+// so a single Listen can export several independent hierarchies, e.g.
+// "", "scratch" and "config". The new tree gets its own /adm/ctl and
+// /adm/group, isolated from every other mounted aname: changes made
+// through one aname's admin files never affect another's. Mounting an
+// aname twice is an error.
+func (fs *FS) Mount(aname, owner string) error {
+	aname = path.Clean(aname)
+	if aname == "." {
+		aname = ""
+	}
+	if owner == "" {
+		owner = fs.hostowner
+	}
+
+	fs.mu.Lock()
+	_, ok := fs.trees[aname]
+	fs.mu.Unlock()
+	if ok {
+		return perror("aname already mounted")
+	}
+
+	rootPath, err := fs.newPath()
+	if err != nil {
+		return err
+	}
+	admPath, err := fs.newPath()
+	if err != nil {
+		return err
+	}
+	groupPath, err := fs.newPath()
+	if err != nil {
+		return err
+	}
+	ctlPath, err := fs.newPath()
+	if err != nil {
+		return err
+	}
+	t := fs.newTree(owner, rootPath, admPath, groupPath, ctlPath)
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if _, ok := fs.trees[aname]; ok {
+		return perror("aname already mounted")
+	}
+	fs.trees[aname] = t
+	return nil
 }
 
 func (fs *FS) Halt() error { return nil }
@@ -175,23 +271,54 @@ func (fs *FS) walk(name string) (*node, error) {
 }
 
 // See http://godoc.org/github.com/mars9/ramfs#Fid
+//
+// Attach selects the tree registered under aname with Mount, falling
+// back to the default ("") tree created by New when aname is empty.
+// Attaching to an aname that was never mounted returns the standard 9P
+// "unknown aname" error.
 func (fs *FS) Attach(uname, aname string) (*Fid, error) {
-	user, err := fs.group.Get(uname)
-	if err != nil {
-		user, _ = fs.group.Get("none")
+	return fs.AttachContext(context.Background(), uname, aname)
+}
+
+// AttachContext is Attach with a ctx that is checked once before the
+// attach. The returned Fid does not keep ctx; reads and writes on it
+// are bounded by the ctx given to FS.ReadContext/WriteContext.
+func (fs *FS) AttachContext(ctx context.Context, uname, aname string) (*Fid, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	uid := user.Name
 
 	aname = path.Clean(aname)
-	node, err := fs.walk(aname)
+	if aname == "." {
+		aname = ""
+	}
+
+	fs.mu.Lock()
+	t, ok := fs.trees[aname]
+	fs.mu.Unlock()
+	if !ok {
+		return nil, perror("unknown aname")
+	}
+
+	user, err := t.group.Get(uname)
 	if err != nil {
-		return nil, err
+		user, _ = t.group.Get("none")
 	}
-	return &Fid{uid: uid, node: node}, nil
+	return &Fid{uid: user.Name, node: t.root}, nil
 }
 
 // See http://godoc.org/github.com/mars9/ramfs#Fid.Create
 func (fs *FS) Create(name string, mode uint8, perm Perm) (*Fid, error) {
+	return fs.CreateContext(context.Background(), name, mode, perm)
+}
+
+// CreateContext is Create with a ctx that is checked once before the
+// create. The returned Fid does not keep ctx.
+func (fs *FS) CreateContext(ctx context.Context, name string, mode uint8, perm Perm) (*Fid, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	user, err := fs.group.Get(fs.hostowner)
 	if err != nil {
 		panic(err) // can't happen
@@ -215,6 +342,17 @@ func (fs *FS) Create(name string, mode uint8, perm Perm) (*Fid, error) {
 
 // See http://godoc.org/github.com/mars9/ramfs#Fid.Open
 func (fs *FS) Open(name string, mode uint8) (*Fid, error) {
+	return fs.OpenContext(context.Background(), name, mode)
+}
+
+// OpenContext is Open with a ctx that is checked once before the open.
+// The returned Fid does not keep ctx; reads and writes on it are
+// bounded by the ctx given to FS.ReadContext/WriteContext.
+func (fs *FS) OpenContext(ctx context.Context, name string, mode uint8) (*Fid, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	user, err := fs.group.Get(fs.hostowner)
 	if err != nil {
 		panic(err) // can't happen
@@ -236,6 +374,16 @@ func (fs *FS) Open(name string, mode uint8) (*Fid, error) {
 
 // See http://godoc.org/github.com/mars9/ramfs#Fid.Remove
 func (fs *FS) Remove(name string) error {
+	return fs.RemoveContext(context.Background(), name)
+}
+
+// RemoveContext is Remove with a ctx that is checked once before the
+// remove; Remove itself does not wait on ctx.
+func (fs *FS) RemoveContext(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	user, err := fs.group.Get(fs.hostowner)
 	if err != nil {
 		panic(err) // can't happen
@@ -253,6 +401,17 @@ func (fs *FS) Remove(name string) error {
 }
 
 func (fs *FS) Listen(network, addr string) error {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return fs.serve(listener)
+}
+
+// serve runs the accept loop against an already-bound net.Listener, so
+// Listen and Serve can share it regardless of how the listener was
+// obtained.
+func (fs *FS) serve(listener net.Listener) error {
 	work := make(chan *transaction)
 	srv := &server{
 		work:    work,
@@ -261,11 +420,6 @@ func (fs *FS) Listen(network, addr string) error {
 		connmap: make(map[uint32]bool),
 	}
 
-	listener, err := net.Listen(network, addr)
-	if err != nil {
-		return err
-	}
-
 	for {
 		rwc, err := listener.Accept()
 		if err != nil {
@@ -0,0 +1,64 @@
+package ramfs
+
+import "testing"
+
+// TestMountIsolatesAdminTrees guards against the regression fixed by
+// scopedTo: newTree used to hand every mounted tree's /adm/ctl the bare
+// top-level *FS, so a ctl command issued against a non-default aname
+// would actually act on whichever tree fs.root/fs.group happened to
+// point at. This test issues no ctl commands; it exercises the
+// structural guarantee newCtl's scoped *FS relies on instead: each
+// mounted tree gets its own root and group, and
+// Attach/Create through one aname never reach another's.
+func TestMountIsolatesAdminTrees(t *testing.T) {
+	fs := New("glenda")
+	if err := fs.Mount("scratch", "scratchowner"); err != nil {
+		t.Fatalf("Mount: %v", err)
+	}
+
+	def := fs.trees[""]
+	scratch := fs.trees["scratch"]
+
+	if def.group == scratch.group {
+		t.Error("default and scratch trees share the same *group, want isolated")
+	}
+	if def.root == scratch.root {
+		t.Error("default and scratch trees share the same root node, want isolated")
+	}
+
+	defFid, err := fs.Attach("glenda", "")
+	if err != nil {
+		t.Fatalf("Attach default: %v", err)
+	}
+	if defFid.node != def.root {
+		t.Error("Attach(\"\") landed on a node other than the default tree's root")
+	}
+
+	scratchFid, err := fs.Attach("scratchowner", "scratch")
+	if err != nil {
+		t.Fatalf("Attach scratch: %v", err)
+	}
+	if scratchFid.node != scratch.root {
+		t.Error("Attach(\"scratch\") landed on a node other than the scratch tree's root")
+	}
+
+	fid, err := scratchFid.Create("only-in-scratch", OWRITE, Perm(0644))
+	if err != nil {
+		t.Fatalf("Create under scratch: %v", err)
+	}
+	fid.Clunk()
+
+	if _, err := fs.Open("/only-in-scratch", OREAD); err == nil {
+		t.Error("/only-in-scratch visible through the default tree, want isolated")
+	}
+}
+
+func TestMountTwiceIsAnError(t *testing.T) {
+	fs := New("glenda")
+	if err := fs.Mount("scratch", "scratchowner"); err != nil {
+		t.Fatalf("first Mount: %v", err)
+	}
+	if err := fs.Mount("scratch", "scratchowner"); err == nil {
+		t.Error("second Mount(\"scratch\", ...) = nil error, want error")
+	}
+}